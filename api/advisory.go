@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// osvBatchURL and osvVulnURLPrefix are vars rather than consts so tests can
+// point them at a mock OSV server.
+var (
+	osvBatchURL      = "https://api.osv.dev/v1/querybatch"
+	osvVulnURLPrefix = "https://api.osv.dev/v1/vulns/"
+)
+
+// Advisory is a single known vulnerability affecting a resolved package
+// version, as reported by OSV.dev.
+type Advisory struct {
+	ID            string   `json:"id"`
+	Summary       string   `json:"summary,omitempty"`
+	Severity      string   `json:"severity,omitempty"`
+	FixedVersions []string `json:"fixed_versions,omitempty"`
+}
+
+// VulnerabilitySummary aggregates advisory counts across an entire
+// resolved tree, similar to `npm audit`'s summary line.
+type VulnerabilitySummary struct {
+	Total      int            `json:"total"`
+	BySeverity map[string]int `json:"by_severity,omitempty"`
+}
+
+// auditedPackage wraps the resolved tree with its vulnerability summary
+// for the ?audit=true response.
+type auditedPackage struct {
+	*NpmPackageVersion
+	Summary *VulnerabilitySummary `json:"summary"`
+}
+
+type osvQuery struct {
+	Package osvPackage `json:"package"`
+	Version string     `json:"version"`
+}
+
+type osvPackage struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+type osvBatchRequest struct {
+	Queries []osvQuery `json:"queries"`
+}
+
+// osvBatchResponse is the shape of /v1/querybatch. The batch endpoint
+// intentionally returns only "id" (and "modified") per vuln to keep batch
+// responses small; the rest of the fields come from a per-ID detail fetch
+// below.
+type osvBatchResponse struct {
+	Results []struct {
+		Vulns []struct {
+			ID string `json:"id"`
+		} `json:"vulns"`
+	} `json:"results"`
+}
+
+// osvVuln is the shape of a single /v1/vulns/{id} response.
+type osvVuln struct {
+	ID       string        `json:"id"`
+	Summary  string        `json:"summary"`
+	Severity []osvSeverity `json:"severity"`
+	Affected []osvAffected `json:"affected"`
+}
+
+type osvSeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+type osvAffected struct {
+	Ranges []struct {
+		Events []struct {
+			Fixed string `json:"fixed"`
+		} `json:"events"`
+	} `json:"ranges"`
+}
+
+func (v osvVuln) severity() string {
+	if len(v.Severity) == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%s", v.Severity[0].Type, v.Severity[0].Score)
+}
+
+func (v osvVuln) fixedVersions() []string {
+	var fixed []string
+	for _, affected := range v.Affected {
+		for _, r := range affected.Ranges {
+			for _, event := range r.Events {
+				if event.Fixed != "" {
+					fixed = append(fixed, event.Fixed)
+				}
+			}
+		}
+	}
+	return fixed
+}
+
+// auditVulnerabilities queries OSV.dev's batched API once for every
+// distinct resolved package in root's tree, fetches full advisory details
+// for every distinct vuln ID the batch call surfaced, annotates each node
+// with any advisories found, and returns the aggregate summary.
+func auditVulnerabilities(ctx context.Context, root *NpmPackageVersion) (*VulnerabilitySummary, error) {
+	nodes := flattenPackages(root)
+
+	queries := make([]osvQuery, len(nodes))
+	for i, node := range nodes {
+		queries[i] = osvQuery{
+			Package: osvPackage{Name: node.Name, Ecosystem: "npm"},
+			Version: node.Version,
+		}
+	}
+
+	body, err := json.Marshal(osvBatchRequest{Queries: queries})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, osvBatchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("osv.dev returned status %d", resp.StatusCode)
+	}
+
+	var parsed osvBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	idsByNode := make([][]string, len(parsed.Results))
+	unique := map[string]struct{}{}
+	for i, result := range parsed.Results {
+		if i >= len(nodes) {
+			break
+		}
+		ids := make([]string, len(result.Vulns))
+		for j, vuln := range result.Vulns {
+			ids[j] = vuln.ID
+			unique[vuln.ID] = struct{}{}
+		}
+		idsByNode[i] = ids
+	}
+
+	details, err := fetchVulnDetails(ctx, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &VulnerabilitySummary{BySeverity: map[string]int{}}
+	for i, ids := range idsByNode {
+		for _, id := range ids {
+			vuln := details[id]
+			severity := vuln.severity()
+			nodes[i].Vulnerabilities = append(nodes[i].Vulnerabilities, Advisory{
+				ID:            id,
+				Summary:       vuln.Summary,
+				Severity:      severity,
+				FixedVersions: vuln.fixedVersions(),
+			})
+			summary.Total++
+			summary.BySeverity[severity]++
+		}
+	}
+
+	return summary, nil
+}
+
+// fetchVulnDetails fetches /v1/vulns/{id} for every id in ids, concurrently,
+// and returns them keyed by ID.
+func fetchVulnDetails(ctx context.Context, ids map[string]struct{}) (map[string]osvVuln, error) {
+	details := make(map[string]osvVuln, len(ids))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			detail, err := fetchVulnDetail(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			details[id] = detail
+		}(id)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return details, nil
+}
+
+// fetchVulnDetail fetches the full advisory record for a single OSV vuln
+// ID, which the batch endpoint omits.
+func fetchVulnDetail(ctx context.Context, id string) (osvVuln, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, osvVulnURLPrefix+id, nil)
+	if err != nil {
+		return osvVuln{}, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return osvVuln{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return osvVuln{}, fmt.Errorf("osv.dev returned status %d for vuln %s", resp.StatusCode, id)
+	}
+
+	var vuln osvVuln
+	if err := json.NewDecoder(resp.Body).Decode(&vuln); err != nil {
+		return osvVuln{}, err
+	}
+	return vuln, nil
+}
+
+// flattenPackages returns every distinct name@version in the tree, so that
+// a package reused across several branches - via the resolver's
+// diamond-dependency dedup - is only queried once. Dependencies are keyed
+// by name@version rather than by pointer: the resolver already reuses a
+// single node for an exact repeat, but two occurrences resolved from
+// different constraints can still land on the same version without
+// sharing a node, and those still shouldn't be queried twice.
+func flattenPackages(root *NpmPackageVersion) []*NpmPackageVersion {
+	var out []*NpmPackageVersion
+	seen := map[string]bool{}
+
+	var walk func(pkg *NpmPackageVersion)
+	walk = func(pkg *NpmPackageVersion) {
+		// A cyclic placeholder never had its own version resolved; the
+		// ancestor it points back to is walked instead.
+		if pkg == nil || pkg.Cyclic {
+			return
+		}
+		key := pkg.Name + "@" + pkg.Version
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		out = append(out, pkg)
+		for _, dep := range pkg.Dependencies {
+			walk(dep)
+		}
+	}
+	walk(root)
+
+	return out
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockOSV starts an httptest server that answers /v1/querybatch with the
+// given vuln IDs for every query, and /v1/vulns/{id} with a fixed detail
+// record, then points the package's OSV URLs at it for the duration of the
+// test.
+func newMockOSV(t *testing.T, vulnIDs []string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/querybatch":
+			var req osvBatchRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+			vulns := make([]map[string]string, len(vulnIDs))
+			for i, id := range vulnIDs {
+				vulns[i] = map[string]string{"id": id}
+			}
+			results := make([]map[string]any, len(req.Queries))
+			for i := range req.Queries {
+				results[i] = map[string]any{"vulns": vulns}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/vulns/"):
+			id := strings.TrimPrefix(r.URL.Path, "/v1/vulns/")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id":       id,
+				"summary":  "a bad bug in " + id,
+				"severity": []map[string]string{{"type": "CVSS_V3", "score": "7.5"}},
+				"affected": []map[string]any{
+					{"ranges": []map[string]any{
+						{"events": []map[string]string{{"fixed": "1.2.3"}}},
+					}},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	origBatch, origVuln := osvBatchURL, osvVulnURLPrefix
+	osvBatchURL = server.URL + "/v1/querybatch"
+	osvVulnURLPrefix = server.URL + "/v1/vulns/"
+	t.Cleanup(func() { osvBatchURL, osvVulnURLPrefix = origBatch, origVuln })
+
+	return server
+}
+
+// TestAuditVulnerabilities checks that auditVulnerabilities fetches full
+// advisory details for every vuln ID the batch call surfaces (not just the
+// bare id/modified pair the batch endpoint itself returns) and annotates
+// the resolved node and aggregate summary with it.
+func TestAuditVulnerabilities(t *testing.T) {
+	newMockOSV(t, []string{"GHSA-test-0001"})
+
+	root := &NpmPackageVersion{
+		Name:         "left-pad",
+		Version:      "1.0.0",
+		Dependencies: map[string]*NpmPackageVersion{},
+	}
+
+	summary, err := auditVulnerabilities(context.Background(), root)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, summary.Total)
+	assert.Equal(t, 1, summary.BySeverity["CVSS_V3:7.5"])
+
+	require.Len(t, root.Vulnerabilities, 1)
+	assert.Equal(t, "GHSA-test-0001", root.Vulnerabilities[0].ID)
+	assert.Equal(t, "a bad bug in GHSA-test-0001", root.Vulnerabilities[0].Summary)
+	assert.Equal(t, "CVSS_V3:7.5", root.Vulnerabilities[0].Severity)
+	assert.Equal(t, []string{"1.2.3"}, root.Vulnerabilities[0].FixedVersions)
+}
+
+// TestAuditVulnerabilitiesDedupesDiamond checks that a diamond dependency
+// (root depends on both a and b, which both depend on the same
+// shared@1.0.0) is only queried once, even when the two occurrences of
+// shared are distinct *NpmPackageVersion nodes rather than a shared
+// pointer - dedup has to go by name@version, not pointer identity.
+func TestAuditVulnerabilitiesDedupesDiamond(t *testing.T) {
+	var queried int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req osvBatchRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		queried = int32(len(req.Queries))
+		results := make([]map[string]any, len(req.Queries))
+		for i := range req.Queries {
+			results[i] = map[string]any{"vulns": []map[string]string{}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	origBatch := osvBatchURL
+	osvBatchURL = server.URL
+	t.Cleanup(func() { osvBatchURL = origBatch })
+
+	shared := func() *NpmPackageVersion {
+		return &NpmPackageVersion{Name: "shared", Version: "1.0.0", Dependencies: map[string]*NpmPackageVersion{}}
+	}
+	root := &NpmPackageVersion{
+		Name:    "root",
+		Version: "1.0.0",
+		Dependencies: map[string]*NpmPackageVersion{
+			"a": {Name: "a", Version: "1.0.0", Dependencies: map[string]*NpmPackageVersion{"shared": shared()}},
+			"b": {Name: "b", Version: "1.0.0", Dependencies: map[string]*NpmPackageVersion{"shared": shared()}},
+		},
+	}
+
+	_, err := auditVulnerabilities(context.Background(), root)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(4), queried, "root, a, b, and one shared entry - not two")
+}
+
+// TestAuditVulnerabilitiesNoFindings checks a clean package yields a
+// zero-value summary and no per-node advisories.
+func TestAuditVulnerabilitiesNoFindings(t *testing.T) {
+	newMockOSV(t, nil)
+
+	root := &NpmPackageVersion{
+		Name:         "left-pad",
+		Version:      "1.0.0",
+		Dependencies: map[string]*NpmPackageVersion{},
+	}
+
+	summary, err := auditVulnerabilities(context.Background(), root)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, summary.Total)
+	assert.Empty(t, root.Vulnerabilities)
+}
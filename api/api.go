@@ -1,19 +1,39 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// registryClient is the RegistryClient used by fetchPackage and
+// fetchPackageMeta to pick a base URL and auth headers per package. It
+// defaults to the public npm registry; call UseRegistryClient to point it
+// at a parsed .npmrc instead (e.g. from an NPM_CONFIG_USERCONFIG path or a
+// --npmrc flag).
+var registryClient = NewRegistryClient()
+
+// UseRegistryClient replaces the registry client used for all subsequent
+// package lookups, e.g. to route scoped packages at private registries.
+func UseRegistryClient(c *RegistryClient) {
+	registryClient = c
+}
+
 // review: add custom error type to return errors from the npm registry endpoint.
 type HTTPError struct {
 	StatusCode int    `json:"status_code"`
@@ -47,11 +67,14 @@ func sendJSONError(w http.ResponseWriter, err *HTTPError) {
 func New() http.Handler {
 	router := mux.NewRouter()
 	router.Handle("/package/{package}/{version}", http.HandlerFunc(packageHandler))
+	router.Handle("/package/{package}/{version}/lockfile", http.HandlerFunc(lockfileHandler))
+	router.Handle("/admin/cache/stats", http.HandlerFunc(cacheStatsHandler))
 	return router
 }
 
 type npmPackageMetaResponse struct {
 	Versions map[string]npmPackageResponse `json:"versions"`
+	DistTags map[string]string             `json:"dist-tags"`
 }
 
 // review: method to extract and convert all versions to a comma-separated string
@@ -78,24 +101,51 @@ type npmPackageResponse struct {
 	Name         string            `json:"name"`
 	Version      string            `json:"version"`
 	Dependencies map[string]string `json:"dependencies"`
+	Dist         npmPackageDist    `json:"dist"`
+}
+
+type npmPackageDist struct {
+	Tarball   string `json:"tarball"`
+	Integrity string `json:"integrity"`
+	Shasum    string `json:"shasum"`
 }
 
 type NpmPackageVersion struct {
 	Name         string                        `json:"name"`
 	Version      string                        `json:"version"`
 	Dependencies map[string]*NpmPackageVersion `json:"dependencies"`
+	// Cyclic is set instead of recursing further when this package already
+	// appears as one of its own ancestors in the tree.
+	Cyclic bool `json:"cyclic,omitempty"`
+	// Truncated is set when MaxDepth was reached before this package's own
+	// dependencies could be resolved.
+	Truncated bool `json:"truncated,omitempty"`
+	// Resolved, Integrity and Shasum mirror the registry's dist metadata.
+	// They're excluded from the default JSON response and exist so
+	// renderLockfile can render a package-lock.json without re-fetching.
+	Resolved  string `json:"-"`
+	Integrity string `json:"-"`
+	Shasum    string `json:"-"`
+	// Vulnerabilities is populated only when the request opts into
+	// ?audit=true.
+	Vulnerabilities []Advisory `json:"vulnerabilities,omitempty"`
 }
 
 func packageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultRequestTimeout)
+	defer cancel()
+
 	vars := mux.Vars(r)
 	pkgName := vars["package"]
 	pkgVersion := vars["version"]
 
 	// review: maps a package with its dependecies
 	rootPkg := &NpmPackageVersion{Name: pkgName, Dependencies: map[string]*NpmPackageVersion{}}
-	if err := resolveDependencies(rootPkg, pkgVersion); err != nil {
-		println(err.Error())
-		if httpErr, ok := err.(*HTTPError); ok {
+	resolver := NewResolver(0, 0)
+	if err := resolver.Resolve(ctx, rootPkg, pkgVersion); err != nil {
+		slog.ErrorContext(ctx, "failed to resolve package", "package", pkgName, "version", pkgVersion, "error", err)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
 			sendJSONError(w, httpErr)
 		} else {
 			sendJSONError(w, NewHTTPError(500, "internal server error"))
@@ -103,7 +153,17 @@ func packageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stringified, err := json.MarshalIndent(rootPkg, "", "  ")
+	var payload interface{} = rootPkg
+	if r.URL.Query().Get("audit") == "true" {
+		summary, err := auditVulnerabilities(ctx, rootPkg)
+		if err != nil {
+			sendJSONError(w, NewHTTPError(502, fmt.Sprintf("failed to audit vulnerabilities: %v", err)))
+			return
+		}
+		payload = &auditedPackage{NpmPackageVersion: rootPkg, Summary: summary}
+	}
+
+	stringified, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		sendJSONError(w, NewHTTPError(500, "failed to marshal JSON"))
 		return
@@ -116,74 +176,18 @@ func packageHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(stringified)
 }
 
-// review: recursively resolves a tree of packages and their associated depdencies
-func resolveDependencies(pkg *NpmPackageVersion, versionConstraint string) error {
-	// review: retuns a list of all published versions including dependencies
-	pkgMeta, err := fetchPackageMeta(pkg.Name)
-	if err != nil {
-		return err
-	}
-	// review: collects all compatible versions, sorts them and then returns the highest compatible version
-	concreteVersion, err := highestCompatibleVersion(versionConstraint, pkgMeta)
-	if err != nil {
-		return err
-	}
-	pkg.Version = concreteVersion
-
-	npmPkg, err := fetchPackage(pkg.Name, pkg.Version)
-	if err != nil {
-		return err
-	}
-	// review: create a WaitGroup to wait for all dependencies to resolve
-	var wg sync.WaitGroup
-	var mu sync.Mutex // To protect shared resources (like pkg.Dependencies) and track errors
-	var firstError error
-	// review: for each depedent package recusively find its package, name and depdencies, i.e. creating
-	// the depdency tree
-	for dependencyName, dependencyVersionConstraint := range npmPkg.Dependencies {
-		wg.Add(1) // reveiw: increment the wait counter
-		// review: have multiple package dependencies resolved simultaneously,
-		// potentially reducing the overall resolution time.
-		go func(depName, depVersion string) {
-			defer wg.Done() // review: decrement the wait counter when done
-			dep := &NpmPackageVersion{Name: depName, Dependencies: map[string]*NpmPackageVersion{}}
-			if err := resolveDependencies(dep, depVersion); err != nil {
-				mu.Lock()
-				if firstError == nil { // Capture only the first error
-					firstError = err
-				}
-				mu.Unlock()
-				return
-			}
-			// review: add the resolved dependency to the parent's dependency list
-			mu.Lock()
-			pkg.Dependencies[depName] = dep
-			mu.Unlock()
-		}(dependencyName, dependencyVersionConstraint)
-	}
-	// review: wait for all goroutines to complete
-	wg.Wait()
-	// review: return the first error encountered, if any
-	if firstError != nil {
-		return firstError
-	}
-	return nil
-}
-
+// highestCompatibleVersion picks the version resolution strategy that
+// matches constraintStr (dist-tag, exact pin, URL/tarball spec, or a
+// semver range) and resolves it against versions.
 func highestCompatibleVersion(constraintStr string, versions *npmPackageMetaResponse) (string, error) {
-	constraint, err := semver.NewConstraint(constraintStr)
-	if err != nil {
-		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("unable to determine version constraint %s: %v", constraintStr, err))
-	}
-	filtered := filterCompatibleVersions(constraint, versions)
-	sort.Sort(filtered)
-	if len(filtered) == 0 {
-		versionStr := versions.GetVersionsAsString()
-		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("no compatabile versions %s for constraint %s: %v", versionStr, constraintStr, err))
-	}
-	return filtered[len(filtered)-1].String(), nil
+	return versionResolverFor(constraintStr, versions).Resolve(constraintStr, versions)
 }
 
+// filterCompatibleVersions returns every published version satisfying
+// constraint. Prereleases are excluded unless constraint itself names one
+// at the same major.minor.patch (Masterminds/semver's default behaviour),
+// or unless includePrereleases has been turned on, in which case a
+// prerelease whose core version satisfies constraint is included too.
 func filterCompatibleVersions(constraint *semver.Constraints, pkgMeta *npmPackageMetaResponse) semver.Collection {
 	var compatible semver.Collection
 	for version := range pkgMeta.Versions {
@@ -193,84 +197,160 @@ func filterCompatibleVersions(constraint *semver.Constraints, pkgMeta *npmPackag
 		}
 		if constraint.Check(semVer) {
 			compatible = append(compatible, semVer)
+			continue
+		}
+		if includePrereleases && semVer.Prerelease() != "" {
+			if core, err := semVer.SetPrerelease(""); err == nil && constraint.Check(&core) {
+				compatible = append(compatible, semVer)
+			}
 		}
 	}
 	return compatible
 }
 
-func fetchPackage(name, version string) (*npmPackageResponse, error) {
-	resp, err := http.Get(fmt.Sprintf("https://registry.npmjs.org/%s/%s", name, version))
+func fetchPackage(ctx context.Context, name, version string) (*npmPackageResponse, error) {
+	key := "pkg:" + name + "@" + version
+	entry, err := cachedFetch(ctx, pkgCache, key, func(ctx context.Context, cached *CacheEntry) (*CacheEntry, error) {
+		return doFetch(ctx, fmt.Sprintf("%s/%s/%s", registryClient.RegistryURL(name), name, version), name, name+"@"+version, cached)
+	})
 	if err != nil {
-
-		// review: process npm registry response
-		if urlErr, ok := err.(*url.Error); ok {
-			// review: determine if the error is a network error or an HTTP status error
-			if urlErr.Timeout() {
-				return nil, NewHTTPError(408, fmt.Sprintf("request timed out for package %s@%s: %v", name, version, urlErr))
-			}
-			// review: this case could be a DNS error, connection refused, etc.
-			return nil, NewHTTPError(502, fmt.Sprintf("bad gateway while fetching package %s@%s: %v", name, version, urlErr))
-		}
-		// review: fallback for any other type of error
-		return nil, NewHTTPError(500, fmt.Sprintf("failed to fetch package %s@%s: %v", name, version, err))
+		return nil, err
 	}
 
-	// reveiw: handle HTTP response
-	// review: defer closing the body
-	defer resp.Body.Close()
-	if resp.StatusCode == 404 {
-		return nil, NewHTTPError(resp.StatusCode, fmt.Sprintf("Unable to find package %s@%s", name, version))
-	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, NewHTTPError(resp.StatusCode, fmt.Sprintf("received unexpected status %d for package %s@%s", resp.StatusCode, name, version))
+	var parsed npmPackageResponse
+	if err := json.Unmarshal(entry.Value, &parsed); err != nil {
+		return nil, NewHTTPError(500, fmt.Sprintf("unable to pars package metadata %s@%s: %v", name, version, err))
 	}
+	return &parsed, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+func fetchPackageMeta(ctx context.Context, p string) (*npmPackageMetaResponse, error) {
+	key := "meta:" + p
+	entry, err := cachedFetch(ctx, metaCache, key, func(ctx context.Context, cached *CacheEntry) (*CacheEntry, error) {
+		return doFetch(ctx, fmt.Sprintf("%s/%s", registryClient.RegistryURL(p), p), p, p, cached)
+	})
 	if err != nil {
-		return nil, NewHTTPError(500, fmt.Sprintf("unable to read response body for package %s@%s: %v", name, version, err))
+		return nil, err
 	}
 
-	var parsed npmPackageResponse
-	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
-		return nil, NewHTTPError(500, fmt.Sprintf("unable to pars package metadata %s@%s: %v", name, version, err))
+	var parsed npmPackageMetaResponse
+	if err := json.Unmarshal(entry.Value, &parsed); err != nil {
+		return nil, NewHTTPError(500, fmt.Sprintf("unable to pars package metadata %s: %v", p, err))
 	}
 	return &parsed, nil
 }
 
-func fetchPackageMeta(p string) (*npmPackageMetaResponse, error) {
-	resp, err := http.Get(fmt.Sprintf("https://registry.npmjs.org/%s", p))
+// cachedFetch returns the cached entry for key if present and fresh,
+// otherwise coalesces concurrent callers for the same key behind a single
+// call to fetch, passing along the last known (possibly expired) entry so
+// fetch can revalidate it with a conditional GET instead of discarding its
+// ETag. It logs whether the lookup was a cache hit and how long it took.
+//
+// The coalesced call is deliberately run with its own context, detached
+// from whichever caller happened to trigger it: singleflight shares one
+// fetch across every concurrent caller for key, so it must not be
+// cancelled just because that particular caller's request was.
+func cachedFetch(ctx context.Context, cache Cache, key string, fetch func(ctx context.Context, cached *CacheEntry) (*CacheEntry, error)) (*CacheEntry, error) {
+	start := time.Now()
+	if entry, ok := cache.Get(key); ok {
+		slog.DebugContext(ctx, "registry lookup", "key", key, "cache_hit", true, "duration", time.Since(start))
+		return entry, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stale, _ := cache.GetStale(key)
+
+	v, err, _ := fetchGroup.Do(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+		defer cancel()
+
+		entry, err := fetch(fetchCtx, stale)
+		if err != nil {
+			return nil, err
+		}
+		cache.Set(key, entry)
+		return entry, nil
+	})
+	slog.DebugContext(ctx, "registry lookup", "key", key, "cache_hit", false, "duration", time.Since(start))
 	if err != nil {
+		return nil, err
+	}
+	return v.(*CacheEntry), nil
+}
+
+// doFetch performs the registry HTTP call for name (used to pick auth),
+// with descr used only in error messages and tracing, issuing a
+// conditional GET if cached carries an ETag.
+func doFetch(ctx context.Context, registryURL, name, descr string, cached *CacheEntry) (*CacheEntry, error) {
+	ctx, span := tracer.Start(ctx, "registry.fetch", trace.WithAttributes(attribute.String("package", descr)))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, registryURL, nil)
+	if err != nil {
+		return nil, NewHTTPError(500, fmt.Sprintf("failed to build request for package %s: %v", descr, err))
+	}
+	registryClient.ApplyAuth(req, name)
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 
 		// review: process npm registry response
 		if urlErr, ok := err.(*url.Error); ok {
 			// review: determine if the error is a network error or an HTTP status error
 			if urlErr.Timeout() {
-				return nil, NewHTTPError(408, fmt.Sprintf("request timed out for package %s: %v", p, urlErr))
+				return nil, NewHTTPError(408, fmt.Sprintf("request timed out for package %s: %v", descr, urlErr))
 			}
 			// review: this case could be a DNS error, connection refused, etc.
-			return nil, NewHTTPError(502, fmt.Sprintf("bad gateway while fetching package %s: %v", p, urlErr))
+			return nil, NewHTTPError(502, fmt.Sprintf("bad gateway while fetching package %s: %v", descr, urlErr))
 		}
 		// review: fallback for any other type of error
-		return nil, NewHTTPError(500, fmt.Sprintf("failed to fetch package %s: %v", p, err))
+		return nil, NewHTTPError(500, fmt.Sprintf("failed to fetch package %s: %v", descr, err))
 	}
-
-	// reveiw: handle HTTP response
-	// review: defer closing the body
 	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.ExpiresAt = cacheExpiry(resp.Header)
+		return cached, nil
+	}
 	if resp.StatusCode == 404 {
-		return nil, NewHTTPError(resp.StatusCode, fmt.Sprintf("unable to find package %s", p))
+		return nil, NewHTTPError(resp.StatusCode, fmt.Sprintf("unable to find package %s", descr))
 	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, NewHTTPError(resp.StatusCode, fmt.Sprintf("received unexpected status %d for package %s", resp.StatusCode, p))
+		return nil, NewHTTPError(resp.StatusCode, fmt.Sprintf("received unexpected status %d for package %s", resp.StatusCode, descr))
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, NewHTTPError(500, fmt.Sprintf("unable to read response body for package %s: %v", p, err))
+		return nil, NewHTTPError(500, fmt.Sprintf("unable to read response body for package %s: %v", descr, err))
 	}
 
-	var parsed npmPackageMetaResponse
-	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
-		return nil, NewHTTPError(500, fmt.Sprintf("unable to pars package metadata %s: %v", p, err))
-	}
+	return &CacheEntry{
+		Value:     body,
+		ETag:      resp.Header.Get("ETag"),
+		ExpiresAt: cacheExpiry(resp.Header),
+	}, nil
+}
 
-	return &parsed, nil
+// cacheExpiry derives a TTL from the registry's Cache-Control max-age
+// header, falling back to a short default when none is present.
+func cacheExpiry(header http.Header) time.Time {
+	const defaultTTL = 5 * time.Minute
+	if cc := header.Get("Cache-Control"); cc != "" {
+		for _, directive := range strings.Split(cc, ",") {
+			directive = strings.TrimSpace(directive)
+			if strings.HasPrefix(directive, "max-age=") {
+				if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+					return time.Now().Add(time.Duration(seconds) * time.Second)
+				}
+			}
+		}
+	}
+	return time.Now().Add(defaultTTL)
 }
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheEntry is what gets stored per key: the raw response body plus enough
+// of the registry's caching headers to issue a conditional GET next time.
+type CacheEntry struct {
+	Value     []byte    `json:"value"`
+	ETag      string    `json:"etag,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e *CacheEntry) expired() bool {
+	return !e.ExpiresAt.IsZero() && time.Now().After(e.ExpiresAt)
+}
+
+// CacheStats is exposed over the admin endpoint so operators can see
+// whether the cache is actually earning its keep.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Entries   int   `json:"entries"`
+	Evictions int64 `json:"evictions"`
+}
+
+// Cache memoizes registry responses by key (typically "meta:<name>" or
+// "pkg:<name>@<version>").
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	// GetStale returns the entry for key even if its TTL has elapsed, so a
+	// caller can revalidate it with a conditional GET instead of discarding
+	// its ETag outright.
+	GetStale(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Stats() CacheStats
+}
+
+// LRUCache is a fixed-size in-memory Cache. It's the default cache used by
+// fetchPackage/fetchPackageMeta.
+type LRUCache struct {
+	mu      sync.Mutex
+	maxSize int
+	items   map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCache returns an in-memory Cache holding at most maxSize entries.
+func NewLRUCache(maxSize int) *LRUCache {
+	return &LRUCache{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	if el.Value.(*lruItem).entry.expired() {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	return el.Value.(*lruItem).entry, true
+}
+
+// GetStale returns the entry for key even if it has expired, keeping it in
+// the LRU rather than evicting it, so its ETag can still be used to
+// revalidate.
+func (c *LRUCache) GetStale(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*lruItem).entry, true
+}
+
+func (c *LRUCache) Set(key string, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruItem).entry = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&lruItem{key: key, entry: entry})
+	c.items[key] = el
+
+	if c.maxSize > 0 && c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*lruItem).key)
+			c.stats.Evictions++
+		}
+	}
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// DiskCache layers an on-disk JSON store behind an underlying Cache
+// (normally an LRUCache), so that a cold process still benefits from
+// lookups a previous process already paid for.
+type DiskCache struct {
+	dir        string
+	underlying Cache
+	mu         sync.Mutex
+}
+
+// NewDiskCache returns a Cache backed by JSON files under dir. Lookups try
+// underlying first for in-memory hits and fall back to disk, populating
+// underlying with whatever is read from disk.
+func NewDiskCache(dir string, underlying Cache) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir, underlying: underlying}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *DiskCache) Get(key string) (*CacheEntry, bool) {
+	if entry, ok := c.underlying.Get(key); ok {
+		return entry, true
+	}
+
+	entry, ok := c.readDisk(key)
+	if !ok || entry.expired() {
+		return nil, false
+	}
+	return entry, true
+}
+
+// GetStale returns the entry for key even if it has expired, so its ETag
+// can still be used to revalidate.
+func (c *DiskCache) GetStale(key string) (*CacheEntry, bool) {
+	if entry, ok := c.underlying.GetStale(key); ok {
+		return entry, true
+	}
+	return c.readDisk(key)
+}
+
+// readDisk loads key's entry from disk, if present, populating the
+// in-memory underlying cache so the next lookup doesn't hit disk again.
+func (c *DiskCache) readDisk(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	c.underlying.Set(key, &entry)
+	return &entry, true
+}
+
+func (c *DiskCache) Set(key string, entry *CacheEntry) {
+	c.underlying.Set(key, entry)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(c.path(key), data, 0o644)
+}
+
+func (c *DiskCache) Stats() CacheStats {
+	return c.underlying.Stats()
+}
+
+// metaCache and pkgCache memoize fetchPackageMeta/fetchPackage responses.
+// Use UseCache to swap in a DiskCache for persistence across restarts (wire
+// up from a --cache-dir flag).
+var (
+	metaCache Cache = NewLRUCache(1000)
+	pkgCache  Cache = NewLRUCache(1000)
+
+	// fetchGroup coalesces concurrent requests for the same key so that N
+	// goroutines resolving the same package only ever trigger one HTTP call.
+	fetchGroup singleflight.Group
+)
+
+// UseCache replaces the caches used for package and package-metadata
+// lookups.
+func UseCache(meta, pkg Cache) {
+	metaCache = meta
+	pkgCache = pkg
+}
+
+// UseCacheDir swaps in a persistent, on-disk cache rooted at dir, wired up
+// from a --cache-dir flag. Each of meta/pkg gets its own subdirectory so
+// the two don't collide.
+func UseCacheDir(dir string) error {
+	meta, err := NewDiskCache(filepath.Join(dir, "meta"), NewLRUCache(1000))
+	if err != nil {
+		return err
+	}
+	pkg, err := NewDiskCache(filepath.Join(dir, "pkg"), NewLRUCache(1000))
+	if err != nil {
+		return err
+	}
+	UseCache(meta, pkg)
+	return nil
+}
+
+// cacheStatsResponse is served from the admin endpoint.
+type cacheStatsResponse struct {
+	Meta CacheStats `json:"meta"`
+	Pkg  CacheStats `json:"pkg"`
+}
+
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := cacheStatsResponse{
+		Meta: metaCache.Stats(),
+		Pkg:  pkgCache.Stats(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
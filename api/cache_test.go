@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCachedFetchRevalidatesExpiredEntry checks that once a cached entry's
+// TTL has elapsed, the next lookup sends a conditional GET using its ETag
+// instead of silently discarding it and re-fetching from scratch, and that
+// a 304 response reuses the cached body.
+func TestCachedFetchRevalidatesExpiredEntry(t *testing.T) {
+	var requests, conditional int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=0")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"versions":{"1.0.0":{"name":"left-pad","version":"1.0.0"}}}`))
+	}))
+	defer server.Close()
+
+	npmrc := filepath.Join(t.TempDir(), ".npmrc")
+	require.NoError(t, os.WriteFile(npmrc, []byte("registry="+server.URL+"\n"), 0o644))
+	client, err := NewRegistryClientFromFile(npmrc)
+	require.NoError(t, err)
+	origClient := registryClient
+	UseRegistryClient(client)
+	defer UseRegistryClient(origClient)
+
+	origMeta, origPkg := metaCache, pkgCache
+	UseCache(NewLRUCache(10), NewLRUCache(10))
+	defer UseCache(origMeta, origPkg)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := fetchPackageMeta(ctx, "left-pad")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests), "expected one HTTP round trip per call")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&conditional), "every call after the first should revalidate via If-None-Match")
+}
+
+// TestCacheGetStaleSurvivesExpiry checks that an expired entry is still
+// retrievable via GetStale (for revalidation) even though Get reports it as
+// a miss, for both the in-memory and disk-backed caches.
+func TestCacheGetStaleSurvivesExpiry(t *testing.T) {
+	expired := &CacheEntry{Value: []byte(`"v1"`), ETag: `"v1"`, ExpiresAt: time.Now().Add(-time.Hour)}
+
+	t.Run("LRUCache", func(t *testing.T) {
+		c := NewLRUCache(10)
+		c.Set("k", expired)
+
+		_, ok := c.Get("k")
+		assert.False(t, ok, "an expired entry should be a Get miss")
+
+		stale, ok := c.GetStale("k")
+		require.True(t, ok, "GetStale should still return the expired entry so it can be revalidated")
+		assert.Equal(t, `"v1"`, stale.ETag)
+	})
+
+	t.Run("DiskCache", func(t *testing.T) {
+		c, err := NewDiskCache(t.TempDir(), NewLRUCache(10))
+		require.NoError(t, err)
+		c.Set("k", expired)
+
+		_, ok := c.Get("k")
+		assert.False(t, ok, "an expired entry should be a Get miss")
+
+		stale, ok := c.GetStale("k")
+		require.True(t, ok, "GetStale should still return the expired entry so it can be revalidated")
+		assert.Equal(t, `"v1"`, stale.ETag)
+	})
+}
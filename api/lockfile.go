@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// lockfileVersion is the npm lockfileVersion renderLockfile produces.
+const lockfileVersion = 3
+
+// Lockfile is the top-level package-lock.json document.
+type Lockfile struct {
+	Name            string                  `json:"name"`
+	Version         string                  `json:"version"`
+	LockfileVersion int                     `json:"lockfileVersion"`
+	Packages        map[string]*LockPackage `json:"packages"`
+}
+
+// LockPackage is a single entry in the "packages" map, keyed by install
+// path (e.g. "node_modules/lodash").
+type LockPackage struct {
+	Version   string            `json:"version"`
+	Resolved  string            `json:"resolved,omitempty"`
+	Integrity string            `json:"integrity,omitempty"`
+	Requires  map[string]string `json:"requires,omitempty"`
+}
+
+// renderLockfile walks a resolved *NpmPackageVersion tree and flattens it
+// into an npm v3-style package-lock.json: every distinct name@version pair
+// gets a single top-level "node_modules/<name>" entry, with conflicting
+// versions of the same name nested under the path of the dependent that
+// requires them. Cyclic back-edges are skipped rather than re-rendered,
+// since the placeholder node they point at never had its own version
+// resolved - but a non-cyclic dependent's "requires" entry for that child
+// still needs a real version string, so it's looked up from the ancestor
+// earlier in the chain that the cycle actually points back to.
+func renderLockfile(root *NpmPackageVersion) *Lockfile {
+	packages := map[string]*LockPackage{
+		"": {Version: root.Version},
+	}
+
+	var walk func(prefix string, pkg *NpmPackageVersion, ancestorVersions map[string]string)
+	walk = func(prefix string, pkg *NpmPackageVersion, ancestorVersions map[string]string) {
+		for name, dep := range pkg.Dependencies {
+			if dep.Cyclic {
+				continue
+			}
+
+			path := "node_modules/" + name
+			if existing, ok := packages[path]; ok && existing.Version != dep.Version {
+				path = prefix + "node_modules/" + name
+			}
+			if _, ok := packages[path]; ok {
+				continue
+			}
+
+			depAncestorVersions := make(map[string]string, len(ancestorVersions)+1)
+			for n, v := range ancestorVersions {
+				depAncestorVersions[n] = v
+			}
+			depAncestorVersions[dep.Name] = dep.Version
+
+			requires := make(map[string]string, len(dep.Dependencies))
+			for depName, child := range dep.Dependencies {
+				if child.Cyclic {
+					if version, ok := depAncestorVersions[depName]; ok {
+						requires[depName] = version
+						continue
+					}
+				}
+				requires[depName] = child.Version
+			}
+			packages[path] = &LockPackage{
+				Version:   dep.Version,
+				Resolved:  dep.Resolved,
+				Integrity: dep.Integrity,
+				Requires:  requires,
+			}
+
+			walk(path+"/", dep, depAncestorVersions)
+		}
+	}
+	walk("", root, map[string]string{root.Name: root.Version})
+
+	return &Lockfile{
+		Name:            root.Name,
+		Version:         root.Version,
+		LockfileVersion: lockfileVersion,
+		Packages:        packages,
+	}
+}
+
+// lockfileHandler resolves the same dependency tree as packageHandler and
+// serializes it as a package-lock.json. It's mounted at
+// /package/{package}/{version}/lockfile. The optional ?format parameter
+// defaults to npm, the only format rendered; any other value, yarn
+// included, is answered with 501 Not Implemented.
+func lockfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultRequestTimeout)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	pkgName := vars["package"]
+	pkgVersion := vars["version"]
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "npm"
+	}
+	if format != "npm" {
+		sendJSONError(w, NewHTTPError(http.StatusNotImplemented, "unsupported lockfile format: "+format))
+		return
+	}
+
+	rootPkg := &NpmPackageVersion{Name: pkgName, Dependencies: map[string]*NpmPackageVersion{}}
+	resolver := NewResolver(0, 0)
+	if err := resolver.Resolve(ctx, rootPkg, pkgVersion); err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) {
+			sendJSONError(w, httpErr)
+		} else {
+			sendJSONError(w, NewHTTPError(500, "internal server error"))
+		}
+		return
+	}
+
+	lock := renderLockfile(rootPkg)
+
+	stringified, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		sendJSONError(w, NewHTTPError(500, "failed to marshal JSON"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_, _ = w.Write(stringified)
+}
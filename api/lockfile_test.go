@@ -0,0 +1,28 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderLockfileCyclicRequires checks that a non-cyclic package's
+// "requires" entry for a cyclic child still carries the child's real
+// version (looked up from the ancestor the cycle points back to), instead
+// of the blank Version the placeholder cyclic node itself carries.
+func TestRenderLockfileCyclicRequires(t *testing.T) {
+	cyclicA := &NpmPackageVersion{Name: "a", Cyclic: true, Dependencies: map[string]*NpmPackageVersion{}}
+	b := &NpmPackageVersion{Name: "b", Version: "3.0.0", Dependencies: map[string]*NpmPackageVersion{"a": cyclicA}}
+	a := &NpmPackageVersion{Name: "a", Version: "2.0.0", Dependencies: map[string]*NpmPackageVersion{"b": b}}
+	root := &NpmPackageVersion{Name: "root", Version: "1.0.0", Dependencies: map[string]*NpmPackageVersion{"a": a}}
+
+	lock := renderLockfile(root)
+
+	bPkg, ok := lock.Packages["node_modules/b"]
+	require.True(t, ok)
+	assert.Equal(t, "2.0.0", bPkg.Requires["a"], "b's requires entry for the cyclic dependency on a should carry a's real resolved version")
+
+	_, ok = lock.Packages["node_modules/b/node_modules/a"]
+	assert.False(t, ok, "the cyclic back-edge itself should not get its own packages entry")
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// tracer instruments registry calls and resolver recursion frames so a
+// single request's work can be followed end-to-end in a trace backend.
+var tracer = otel.Tracer("github.com/snyk/snyk-code-review-exercise/api")
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+}
+
+// httpClient is shared by every registry and OSV call instead of
+// http.DefaultClient, so connections to the registry get reused across
+// requests rather than dialled fresh each time.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+		}).DialContext,
+	},
+}
+
+// defaultRequestTimeout bounds how long a single /package request is
+// allowed to run, covering the whole resolution tree, not just one HTTP
+// call. SetRequestTimeout overrides it, e.g. from a --timeout flag.
+var defaultRequestTimeout = 30 * time.Second
+
+// SetRequestTimeout changes the per-request timeout applied to
+// packageHandler and lockfileHandler.
+func SetRequestTimeout(d time.Duration) {
+	defaultRequestTimeout = d
+}
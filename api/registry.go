@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultRegistryURL is used for any scope that has no explicit mapping in
+// the parsed .npmrc config, matching npm's own fallback behaviour.
+const defaultRegistryURL = "https://registry.npmjs.org"
+
+// RegistryClient resolves the base URL and auth headers to use for a given
+// package name, based on an npm-style .npmrc config. Config is keyed by
+// scope (e.g. "@myorg") with a single default entry ("") for unscoped
+// packages.
+type RegistryClient struct {
+	defaultRegistry string
+	scopes          map[string]registryConfig
+	hosts           map[string]registryConfig
+}
+
+// registryConfig holds the registry URL and auth settings that apply to a
+// single scope.
+type registryConfig struct {
+	registry   string
+	authToken  string
+	auth       string
+	alwaysAuth bool
+}
+
+// NewRegistryClient returns a RegistryClient that only ever talks to the
+// public npm registry. It's the client used when no .npmrc is configured.
+func NewRegistryClient() *RegistryClient {
+	return &RegistryClient{
+		defaultRegistry: defaultRegistryURL,
+		scopes:          map[string]registryConfig{},
+		hosts:           map[string]registryConfig{},
+	}
+}
+
+// NewRegistryClientFromFile parses an .npmrc-style INI file at path and
+// builds a RegistryClient from it. Recognised keys:
+//
+//	registry=<url>
+//	@scope:registry=<url>
+//	//<host>/:_authToken=<token>
+//	@scope:_authToken=<token>
+//	_auth=<base64>
+//	always-auth=true|false
+func NewRegistryClientFromFile(path string) (*RegistryClient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	client := NewRegistryClient()
+	scopes := map[string]registryConfig{}
+	hosts := map[string]registryConfig{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		switch {
+		case key == "registry":
+			client.defaultRegistry = strings.TrimRight(value, "/")
+		case key == "_authToken":
+			cfg := scopes[""]
+			cfg.authToken = value
+			scopes[""] = cfg
+		case key == "_auth":
+			cfg := scopes[""]
+			cfg.auth = value
+			scopes[""] = cfg
+		case key == "always-auth":
+			cfg := scopes[""]
+			cfg.alwaysAuth = value == "true"
+			scopes[""] = cfg
+		case strings.HasPrefix(key, "@"):
+			scope, field, ok := strings.Cut(key, ":")
+			if !ok {
+				continue
+			}
+			cfg := scopes[scope]
+			switch field {
+			case "registry":
+				cfg.registry = strings.TrimRight(value, "/")
+			case "_authToken":
+				cfg.authToken = value
+			case "_auth":
+				cfg.auth = value
+			case "always-auth":
+				cfg.alwaysAuth = value == "true"
+			}
+			scopes[scope] = cfg
+		case strings.HasPrefix(key, "//"):
+			host, field, ok := splitHostKey(key)
+			if !ok {
+				continue
+			}
+			cfg := hosts[host]
+			switch field {
+			case "_authToken":
+				cfg.authToken = value
+			case "_auth":
+				cfg.auth = value
+			case "always-auth":
+				cfg.alwaysAuth = value == "true"
+			}
+			hosts[host] = cfg
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	client.scopes = scopes
+	client.hosts = hosts
+	return client, nil
+}
+
+// splitHostKey splits a "//<host>/<path>:_field" npmrc key into the host
+// (e.g. "registry.npmjs.org") and the field name (e.g. "_authToken"),
+// ignoring any path segment between the host and the field.
+func splitHostKey(key string) (host, field string, ok bool) {
+	rest := strings.TrimPrefix(key, "//")
+	idx := strings.Index(rest, "/:")
+	if idx < 0 {
+		return "", "", false
+	}
+	host, _, _ = strings.Cut(rest[:idx], "/")
+	return host, rest[idx+len("/:"):], true
+}
+
+// packageScope returns the scope portion of a package name, e.g.
+// "@myorg/foo" -> "@myorg", or "" for unscoped packages.
+func packageScope(name string) string {
+	if !strings.HasPrefix(name, "@") {
+		return ""
+	}
+	scope, _, ok := strings.Cut(name, "/")
+	if !ok {
+		return ""
+	}
+	return scope
+}
+
+// RegistryURL returns the base registry URL to use when fetching the given
+// package name.
+func (c *RegistryClient) RegistryURL(name string) string {
+	if cfg, ok := c.scopes[packageScope(name)]; ok && cfg.registry != "" {
+		return cfg.registry
+	}
+	return c.defaultRegistry
+}
+
+// registryHost returns the host portion of a registry base URL, e.g.
+// "https://registry.npmjs.org" -> "registry.npmjs.org".
+func registryHost(registryURL string) string {
+	u, err := url.Parse(registryURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// ApplyAuth sets whatever auth header is configured for the given package's
+// scope on req, if any. A host-keyed entry (`//<host>/:_authToken=...`) for
+// the resolved registry takes priority over the package's scope config,
+// matching npm's own precedence. Unless always-auth is set, credentials
+// configured for a scope are withheld once resolution falls back to the
+// public npm registry, so a private-registry token never leaks to it.
+func (c *RegistryClient) ApplyAuth(req *http.Request, name string) {
+	cfg, ok := c.scopes[packageScope(name)]
+	if !ok {
+		cfg = c.scopes[""]
+	}
+	registryURL := c.RegistryURL(name)
+	if hostCfg, ok := c.hosts[registryHost(registryURL)]; ok {
+		cfg = hostCfg
+	}
+	if !cfg.alwaysAuth && registryURL == defaultRegistryURL {
+		return
+	}
+	switch {
+	case cfg.authToken != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.authToken)
+	case cfg.auth != "":
+		req.Header.Set("Authorization", "Basic "+cfg.auth)
+	}
+}
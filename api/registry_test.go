@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeNpmrc writes contents to a temporary .npmrc file and returns its
+// path.
+func writeNpmrc(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".npmrc")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	return path
+}
+
+// TestRegistryURLScoped checks that a scoped package is routed to its
+// scope's registry, falling back to the default registry for everything
+// else.
+func TestRegistryURLScoped(t *testing.T) {
+	client, err := NewRegistryClientFromFile(writeNpmrc(t, ""+
+		"registry=https://registry.npmjs.org\n"+
+		"@myorg:registry=https://npm.myorg.example/\n",
+	))
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://npm.myorg.example", client.RegistryURL("@myorg/foo"))
+	assert.Equal(t, "https://registry.npmjs.org", client.RegistryURL("left-pad"))
+}
+
+// TestApplyAuthHostTokenTakesPriority checks that a host-keyed auth token
+// for the scope's resolved registry overrides the scope's own
+// _authToken/_auth config, matching npm's precedence.
+func TestApplyAuthHostTokenTakesPriority(t *testing.T) {
+	client, err := NewRegistryClientFromFile(writeNpmrc(t, ""+
+		"@myorg:registry=https://npm.myorg.example/\n"+
+		"@myorg:_authToken=scope-token\n"+
+		"//npm.myorg.example/:_authToken=host-token\n",
+	))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://npm.myorg.example/foo", nil)
+	require.NoError(t, err)
+	client.ApplyAuth(req, "@myorg/foo")
+
+	assert.Equal(t, "Bearer host-token", req.Header.Get("Authorization"))
+}
+
+// TestApplyAuthWithheldFromPublicRegistryByDefault checks that a scope's
+// credentials aren't sent once resolution falls back to the public
+// registry (e.g. the scope has no registry override), unless always-auth
+// is set.
+func TestApplyAuthWithheldFromPublicRegistryByDefault(t *testing.T) {
+	client, err := NewRegistryClientFromFile(writeNpmrc(t, "_authToken=some-token\n"))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://registry.npmjs.org/left-pad", nil)
+	require.NoError(t, err)
+	client.ApplyAuth(req, "left-pad")
+
+	assert.Empty(t, req.Header.Get("Authorization"), "a token shouldn't leak to the public registry unless always-auth is set")
+}
+
+// TestApplyAuthAlwaysAuth checks that always-auth=true sends credentials
+// even to the public registry.
+func TestApplyAuthAlwaysAuth(t *testing.T) {
+	client, err := NewRegistryClientFromFile(writeNpmrc(t, ""+
+		"_authToken=some-token\n"+
+		"always-auth=true\n",
+	))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://registry.npmjs.org/left-pad", nil)
+	require.NoError(t, err)
+	client.ApplyAuth(req, "left-pad")
+
+	assert.Equal(t, "Bearer some-token", req.Header.Get("Authorization"))
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultMaxDepth and DefaultMaxConcurrency bound resolution of
+// pathological trees (deeply nested or highly cyclic dependency graphs) so
+// a single request can't explode into unbounded goroutines or recurse
+// forever.
+const (
+	DefaultMaxDepth       = 50
+	DefaultMaxConcurrency = 32
+)
+
+// Resolver carries the state shared across one Resolve call tree: already
+// resolved name@version nodes, so diamond dependencies are fetched once
+// and their subtree reused, plus a semaphore bounding how many lookups run
+// concurrently.
+type Resolver struct {
+	MaxDepth       int
+	MaxConcurrency int
+
+	sem chan struct{}
+
+	mu       sync.Mutex
+	resolved map[string]*NpmPackageVersion
+}
+
+// NewResolver returns a Resolver with the given bounds. A maxDepth or
+// maxConcurrency of 0 uses the package defaults.
+func NewResolver(maxDepth, maxConcurrency int) *Resolver {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if maxConcurrency <= 0 {
+		maxConcurrency = DefaultMaxConcurrency
+	}
+	return &Resolver{
+		MaxDepth:       maxDepth,
+		MaxConcurrency: maxConcurrency,
+		sem:            make(chan struct{}, maxConcurrency),
+		resolved:       map[string]*NpmPackageVersion{},
+	}
+}
+
+// loadOrStoreResolved returns the node already registered for key, if any;
+// otherwise it registers pkg. The check and the store happen under one lock
+// so two branches resolving the same name@version concurrently agree on a
+// single node.
+func (r *Resolver) loadOrStoreResolved(key string, pkg *NpmPackageVersion) (*NpmPackageVersion, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.resolved[key]; ok {
+		return existing, true
+	}
+	r.resolved[key] = pkg
+	return pkg, false
+}
+
+// Resolve resolves pkg's version against versionConstraint and recursively
+// resolves its dependency tree in place, reusing already-resolved
+// name@version subtrees, marking cycles instead of recursing into them,
+// and enforcing MaxDepth/MaxConcurrency. Errors from every branch of the
+// tree are joined rather than only the first one encountered. Resolution
+// stops as soon as ctx is cancelled, e.g. because the client disconnected
+// or the per-request timeout elapsed.
+func (r *Resolver) Resolve(ctx context.Context, pkg *NpmPackageVersion, versionConstraint string) error {
+	// The root call always registers pkg itself as the resolved node for
+	// its key (resolveOne's dedup check can only fire for a key already
+	// put into a prior, different call), so the returned node is always
+	// pkg and can be discarded here.
+	_, err := r.resolve(ctx, pkg, versionConstraint, map[string]struct{}{}, 0)
+	return err
+}
+
+func (r *Resolver) resolve(ctx context.Context, pkg *NpmPackageVersion, versionConstraint string, ancestors map[string]struct{}, depth int) (*NpmPackageVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracer.Start(ctx, "resolver.resolve", trace.WithAttributes(
+		attribute.String("package", pkg.Name),
+		attribute.String("constraint", versionConstraint),
+		attribute.Int("depth", depth),
+	))
+	defer span.End()
+
+	start := time.Now()
+	resolved, err := r.resolveOne(ctx, pkg, versionConstraint, ancestors, depth)
+	slog.DebugContext(ctx, "resolved package",
+		"package", pkg.Name,
+		"version", pkg.Version,
+		"depth", depth,
+		"duration", time.Since(start),
+		"cyclic", pkg.Cyclic,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return resolved, err
+}
+
+// resolveOne resolves pkg in place and returns the canonical node the
+// caller should link into its parent's Dependencies: normally pkg itself,
+// but if an identical name@version was already resolved elsewhere in the
+// tree, that existing node is returned instead so the whole subtree
+// (including its Cyclic/Truncated state) is genuinely shared rather than
+// copied field-by-field onto a second node.
+func (r *Resolver) resolveOne(ctx context.Context, pkg *NpmPackageVersion, versionConstraint string, ancestors map[string]struct{}, depth int) (*NpmPackageVersion, error) {
+	if _, onPath := ancestors[pkg.Name]; onPath {
+		pkg.Cyclic = true
+		return pkg, nil
+	}
+
+	// The semaphore only bounds concurrent registry lookups, not the whole
+	// subtree: it's released below before recursing into dependencies, so a
+	// goroutine never holds its own slot while waiting on a slot for its
+	// children. Holding across the recursion would let a chain deeper than
+	// MaxConcurrency deadlock, since every slot would end up stuck waiting
+	// on one more slot that never frees.
+	if err := r.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	pkgMeta, err := fetchPackageMeta(ctx, pkg.Name)
+	if err != nil {
+		r.release()
+		return nil, err
+	}
+	concreteVersion, err := highestCompatibleVersion(versionConstraint, pkgMeta)
+	if err != nil {
+		r.release()
+		return nil, err
+	}
+	pkg.Version = concreteVersion
+
+	// A package we've already fully (or currently) resolved elsewhere in
+	// the tree at this exact version: reuse its node (and therefore its
+	// dependency subtree) instead of re-fetching and re-descending into it.
+	key := pkg.Name + "@" + pkg.Version
+	if existing, ok := r.loadOrStoreResolved(key, pkg); ok && existing != pkg {
+		r.release()
+		return existing, nil
+	}
+
+	if depth >= r.MaxDepth {
+		r.release()
+		pkg.Truncated = true
+		return pkg, nil
+	}
+
+	npmPkg, err := fetchPackage(ctx, pkg.Name, pkg.Version)
+	r.release()
+	if err != nil {
+		return nil, err
+	}
+	pkg.Resolved = npmPkg.Dist.Tarball
+	pkg.Integrity = npmPkg.Dist.Integrity
+	pkg.Shasum = npmPkg.Dist.Shasum
+
+	childAncestors := make(map[string]struct{}, len(ancestors)+1)
+	for name := range ancestors {
+		childAncestors[name] = struct{}{}
+	}
+	childAncestors[pkg.Name] = struct{}{}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for dependencyName, dependencyVersionConstraint := range npmPkg.Dependencies {
+		wg.Add(1)
+		go func(depName, depVersion string) {
+			defer wg.Done()
+
+			dep := &NpmPackageVersion{Name: depName, Dependencies: map[string]*NpmPackageVersion{}}
+			resolved, err := r.resolve(ctx, dep, depVersion, childAncestors, depth+1)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			pkg.Dependencies[depName] = resolved
+			mu.Unlock()
+		}(dependencyName, dependencyVersionConstraint)
+	}
+	wg.Wait()
+
+	return pkg, errors.Join(errs...)
+}
+
+// acquire reserves a concurrent-lookup slot, or returns ctx's error if ctx
+// is cancelled first.
+func (r *Resolver) acquire(ctx context.Context) error {
+	select {
+	case r.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a slot reserved by acquire.
+func (r *Resolver) release() {
+	<-r.sem
+}
@@ -0,0 +1,206 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snyk/snyk-code-review-exercise/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// metaPayload builds the npmPackageMetaResponse JSON shape for a package
+// that has a single published version, "1.0.0", with the given
+// dependencies.
+func metaPayload(name string, deps map[string]string) any {
+	return map[string]any{
+		"versions": map[string]any{
+			"1.0.0": map[string]any{
+				"name":         name,
+				"version":      "1.0.0",
+				"dependencies": deps,
+			},
+		},
+	}
+}
+
+// versionPayload builds the npmPackageResponse JSON shape for a concrete
+// package@version.
+func versionPayload(name string, deps map[string]string) any {
+	return map[string]any{
+		"name":         name,
+		"version":      "1.0.0",
+		"dependencies": deps,
+	}
+}
+
+// servePackage writes a meta or concrete-version payload depending on
+// whether r.URL.Path is "/<name>" or "/<name>/<version>".
+func servePackage(w http.ResponseWriter, r *http.Request, deps map[string]string) {
+	name := strings.Trim(r.URL.Path, "/")
+	w.Header().Set("Content-Type", "application/json")
+	if parts := strings.Split(name, "/"); len(parts) == 2 {
+		_ = json.NewEncoder(w).Encode(versionPayload(parts[0], deps))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(metaPayload(name, deps))
+}
+
+// newMockRegistry starts an httptest server serving the given package
+// metadata/version payloads, keyed by "<name>" (meta) and "<name>/<version>"
+// (concrete package) paths, and points the api package's registry client at
+// it via a temporary .npmrc.
+func newMockRegistry(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	npmrc := filepath.Join(t.TempDir(), ".npmrc")
+	require.NoError(t, os.WriteFile(npmrc, []byte(fmt.Sprintf("registry=%s\n", server.URL)), 0o644))
+
+	client, err := api.NewRegistryClientFromFile(npmrc)
+	require.NoError(t, err)
+	api.UseRegistryClient(client)
+	t.Cleanup(func() { api.UseRegistryClient(api.NewRegistryClient()) })
+
+	return server
+}
+
+// TestResolveDetectsCycle constructs a synthetic cycle (cycle-a depends on
+// cycle-b depends on cycle-a) and asserts resolution terminates and marks
+// the repeated package as cyclic instead of recursing forever.
+func TestResolveDetectsCycle(t *testing.T) {
+	versions := map[string]map[string]string{
+		"cycle-a": {"cycle-b": "^1.0.0"},
+		"cycle-b": {"cycle-a": "^1.0.0"},
+	}
+
+	newMockRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0]
+		deps, ok := versions[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		servePackage(w, r, deps)
+	})
+
+	root := &api.NpmPackageVersion{Name: "cycle-a", Dependencies: map[string]*api.NpmPackageVersion{}}
+	resolver := api.NewResolver(0, 0)
+	err := resolver.Resolve(context.Background(), root, "^1.0.0")
+	require.NoError(t, err)
+
+	b := root.Dependencies["cycle-b"]
+	require.NotNil(t, b)
+	assert.False(t, b.Cyclic)
+
+	a := b.Dependencies["cycle-a"]
+	require.NotNil(t, a)
+	assert.True(t, a.Cyclic, "revisiting cycle-a via cycle-b should be marked cyclic, not recursed into")
+}
+
+// TestResolveEnforcesMaxDepth checks that a long dependency chain is cut
+// off at MaxDepth rather than recursing indefinitely.
+func TestResolveEnforcesMaxDepth(t *testing.T) {
+	const chainLength = 5
+
+	newMockRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0]
+		var n int
+		if _, err := fmt.Sscanf(name, "chain-%d", &n); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		deps := map[string]string{}
+		if n < chainLength {
+			deps[fmt.Sprintf("chain-%d", n+1)] = "^1.0.0"
+		}
+		servePackage(w, r, deps)
+	})
+
+	root := &api.NpmPackageVersion{Name: "chain-1", Dependencies: map[string]*api.NpmPackageVersion{}}
+	resolver := api.NewResolver(1, 0)
+	require.NoError(t, resolver.Resolve(context.Background(), root, "^1.0.0"))
+
+	assert.False(t, root.Truncated)
+	next := root.Dependencies["chain-2"]
+	require.NotNil(t, next)
+	assert.True(t, next.Truncated, "resolution should stop once MaxDepth is reached")
+}
+
+// TestResolveDiamondReusesNode checks that when two branches of the tree
+// depend on the same name@version, the resolver links them to the very
+// same *NpmPackageVersion node rather than a field-by-field copy, so a
+// caller walking the tree by pointer sees it once.
+func TestResolveDiamondReusesNode(t *testing.T) {
+	versions := map[string]map[string]string{
+		"root":   {"left": "^1.0.0", "right": "^1.0.0"},
+		"left":   {"shared": "^1.0.0"},
+		"right":  {"shared": "^1.0.0"},
+		"shared": {},
+	}
+
+	newMockRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0]
+		deps, ok := versions[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		servePackage(w, r, deps)
+	})
+
+	root := &api.NpmPackageVersion{Name: "root", Dependencies: map[string]*api.NpmPackageVersion{}}
+	resolver := api.NewResolver(0, 0)
+	require.NoError(t, resolver.Resolve(context.Background(), root, "^1.0.0"))
+
+	left := root.Dependencies["left"].Dependencies["shared"]
+	right := root.Dependencies["right"].Dependencies["shared"]
+	require.NotNil(t, left)
+	require.NotNil(t, right)
+	assert.Same(t, left, right, "both branches should share the very same resolved node for shared@1.0.0")
+}
+
+// TestResolveChainDeeperThanMaxConcurrency checks that a dependency chain
+// longer than MaxConcurrency still resolves instead of deadlocking: every
+// goroutine in the chain would hold its own concurrency slot while waiting
+// for a slot to resolve its child, so with MaxConcurrency=1 a chain of
+// length >1 deadlocks unless slots are released before recursing.
+func TestResolveChainDeeperThanMaxConcurrency(t *testing.T) {
+	const chainLength = 5
+
+	newMockRegistry(t, func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0]
+		var n int
+		if _, err := fmt.Sscanf(name, "chain-%d", &n); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		deps := map[string]string{}
+		if n < chainLength {
+			deps[fmt.Sprintf("chain-%d", n+1)] = "^1.0.0"
+		}
+		servePackage(w, r, deps)
+	})
+
+	root := &api.NpmPackageVersion{Name: "chain-1", Dependencies: map[string]*api.NpmPackageVersion{}}
+	resolver := api.NewResolver(api.DefaultMaxDepth, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	require.NoError(t, resolver.Resolve(ctx, root, "^1.0.0"))
+
+	next := root
+	for n := 1; n < chainLength; n++ {
+		next = next.Dependencies[fmt.Sprintf("chain-%d", n+1)]
+		require.NotNil(t, next, "chain-%d should have resolved", n+1)
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// VersionResolver picks a concrete published version out of a package's
+// metadata for a given version constraint string. Different constraint
+// shapes - semver ranges, dist-tags, exact pins, URL specs - need
+// different resolution strategies; versionResolverFor picks the right one
+// by inspecting the constraint itself.
+type VersionResolver interface {
+	Resolve(constraint string, meta *npmPackageMetaResponse) (string, error)
+}
+
+// versionResolverFor selects a VersionResolver for constraint, in the
+// order npm itself would try them: an explicit URL/tarball spec, a
+// dist-tag (e.g. "latest", "next"), an exact version pin, and finally a
+// semver range.
+func versionResolverFor(constraint string, meta *npmPackageMetaResponse) VersionResolver {
+	if isURLSpec(constraint) {
+		return urlVersionResolver{}
+	}
+	if meta != nil {
+		if _, ok := meta.DistTags[constraint]; ok {
+			return distTagVersionResolver{}
+		}
+		if _, ok := meta.Versions[constraint]; ok {
+			return exactVersionResolver{}
+		}
+	}
+	return semverRangeResolver{}
+}
+
+func isURLSpec(constraint string) bool {
+	return strings.Contains(constraint, "://") || strings.HasPrefix(constraint, "git+") || strings.HasPrefix(constraint, "git:")
+}
+
+// distTagVersionResolver resolves dist-tags such as "latest" or "next" via
+// the package metadata's "dist-tags" map.
+type distTagVersionResolver struct{}
+
+func (distTagVersionResolver) Resolve(constraint string, meta *npmPackageMetaResponse) (string, error) {
+	version, ok := meta.DistTags[constraint]
+	if !ok {
+		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("unknown dist-tag %s", constraint))
+	}
+	if _, ok := meta.Versions[version]; !ok {
+		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("dist-tag %s points to unpublished version %s", constraint, version))
+	}
+	return version, nil
+}
+
+// exactVersionResolver resolves a constraint that is itself the exact
+// version string of a published release (an explicit pin).
+type exactVersionResolver struct{}
+
+func (exactVersionResolver) Resolve(constraint string, meta *npmPackageMetaResponse) (string, error) {
+	if _, ok := meta.Versions[constraint]; !ok {
+		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("unpublished version %s", constraint))
+	}
+	return constraint, nil
+}
+
+// urlVersionResolver passes a git/URL/tarball dependency spec through
+// unresolved: there's no registry version to pick, so the spec itself
+// becomes the "version" recorded on the node.
+type urlVersionResolver struct{}
+
+func (urlVersionResolver) Resolve(constraint string, _ *npmPackageMetaResponse) (string, error) {
+	return constraint, nil
+}
+
+// includePrereleases controls whether semverRangeResolver considers
+// prerelease versions that a range wouldn't otherwise implicitly match.
+// SetIncludePrereleases overrides it, e.g. from an --include-prereleases
+// flag.
+var includePrereleases = false
+
+// SetIncludePrereleases toggles whether semver range resolution considers
+// prerelease versions beyond Masterminds/semver's own implicit rule (a
+// prerelease only matches a range that itself names a prerelease at the
+// same major.minor.patch). With include=true, any prerelease whose core
+// version (prerelease component stripped) satisfies the range is eligible.
+func SetIncludePrereleases(include bool) {
+	includePrereleases = include
+}
+
+// semverRangeResolver handles ordinary semver ranges (^1.2.3, ~1.2, >=1
+// <2, etc). By default it excludes prerelease versions unless the range
+// itself references one, matching npm's own behaviour - Masterminds/semver
+// already does this as long as we don't strip the prerelease component out
+// of the constraint or the candidate versions. SetIncludePrereleases(true)
+// widens this to consider every prerelease whose core version satisfies
+// the range.
+type semverRangeResolver struct{}
+
+func (semverRangeResolver) Resolve(constraintStr string, meta *npmPackageMetaResponse) (string, error) {
+	constraint, err := semver.NewConstraint(constraintStr)
+	if err != nil {
+		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("unable to determine version constraint %s: %v", constraintStr, err))
+	}
+	filtered := filterCompatibleVersions(constraint, meta)
+	sort.Sort(filtered)
+	if len(filtered) == 0 {
+		versionStr := meta.GetVersionsAsString()
+		return "", NewHTTPError(http.StatusNotFound, fmt.Sprintf("no compatabile versions %s for constraint %s", versionStr, constraintStr))
+	}
+	return filtered[len(filtered)-1].String(), nil
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSemverRangeResolverPrereleaseToggle checks that a prerelease outside
+// a range's implicit prerelease window is excluded by default, and
+// included once SetIncludePrereleases(true) is in effect.
+func TestSemverRangeResolverPrereleaseToggle(t *testing.T) {
+	defer SetIncludePrereleases(false)
+
+	meta := &npmPackageMetaResponse{
+		Versions: map[string]npmPackageResponse{
+			"1.0.0":      {},
+			"2.0.0-beta": {},
+		},
+	}
+
+	SetIncludePrereleases(false)
+	version, err := (semverRangeResolver{}).Resolve("^1.0.0 || ^2.0.0", meta)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", version, "2.0.0-beta shouldn't match ^2.0.0 by default, since the range names no prerelease")
+
+	SetIncludePrereleases(true)
+	version, err = (semverRangeResolver{}).Resolve("^1.0.0 || ^2.0.0", meta)
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0-beta", version, "with includePrereleases on, 2.0.0-beta's core version 2.0.0 satisfies ^2.0.0")
+}
+
+// TestFilterCompatibleVersionsPrereleaseToggle checks the lower-level
+// filtering behaviour directly against a single range.
+func TestFilterCompatibleVersionsPrereleaseToggle(t *testing.T) {
+	defer SetIncludePrereleases(false)
+
+	constraint, err := semver.NewConstraint("^2.0.0")
+	require.NoError(t, err)
+	meta := &npmPackageMetaResponse{
+		Versions: map[string]npmPackageResponse{
+			"2.0.0-beta": {},
+		},
+	}
+
+	SetIncludePrereleases(false)
+	assert.Empty(t, filterCompatibleVersions(constraint, meta))
+
+	SetIncludePrereleases(true)
+	filtered := filterCompatibleVersions(constraint, meta)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "2.0.0-beta", filtered[0].Original())
+}